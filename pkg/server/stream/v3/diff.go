@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// resourceVersion returns a stable content hash for resource, suitable for
+// use as a delta-xDS resource version. It is computed from a deterministic
+// proto marshal, so two semantically identical messages always hash the same
+// regardless of map/field ordering.
+func resourceVersion(resource proto.Message) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// pendingDiff is the result of DiffAgainst, held until the caller commits it
+// with CommitDiff so that a failed send does not poison the known state.
+type pendingDiff struct {
+	versions map[string]string
+	removed  []string
+}
+
+// DiffAgainst computes the set of resources that have been added or changed,
+// and the set that have been removed, by comparing the content hash of each
+// resource in resources against the versions last committed for typeURL. The
+// diff is not applied to the stored resourceVersions until it is committed
+// via CommitDiff(typeURL), so a failed send can be retried without losing
+// track of what the client actually has.
+//
+// Both added and removed are computed only against
+// s.resourceVersions[typeURL], never any other type URL's versions, since a
+// resource name is only unique within its type URL: an aggregated stream can
+// see, e.g., a CDS cluster and an EDS ClusterLoadAssignment that share a
+// name, and they must not be confused for one another.
+//
+// The pending diff itself is likewise kept per type URL (s.pendingDiffs), so
+// calling DiffAgainst for a second type URL before the first is committed
+// does not discard the first type URL's diff.
+func (s *StreamState) DiffAgainst(typeURL string, resources map[string]proto.Message) (added map[string]proto.Message, removed []string, err error) {
+	added = make(map[string]proto.Message)
+	versions := make(map[string]string, len(resources))
+	committed := s.resourceVersions[typeURL]
+
+	for name, resource := range resources {
+		version, verr := resourceVersion(resource)
+		if verr != nil {
+			return nil, nil, verr
+		}
+		versions[name] = version
+		if existing, ok := committed[name]; !ok || existing != version {
+			added[name] = resource
+		}
+	}
+
+	for name := range committed {
+		if _, ok := resources[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	if s.pendingDiffs == nil {
+		s.pendingDiffs = make(map[string]*pendingDiff)
+	}
+	s.pendingDiffs[typeURL] = &pendingDiff{versions: versions, removed: removed}
+	return added, removed, nil
+}
+
+// CommitDiff applies the most recently computed DiffAgainst(typeURL) result
+// to the stored resourceVersions. It must be called only after the
+// corresponding response has actually been sent to the client.
+//
+// It merges rather than replaces s.resourceVersions[typeURL], so a commit
+// for one type URL never discards another type URL's already-committed
+// state on an aggregated stream.
+func (s *StreamState) CommitDiff(typeURL string) {
+	pending, ok := s.pendingDiffs[typeURL]
+	if !ok {
+		return
+	}
+	if s.resourceVersions == nil {
+		s.resourceVersions = make(map[string]map[string]string)
+	}
+	versions := s.resourceVersions[typeURL]
+	if versions == nil {
+		versions = make(map[string]string, len(pending.versions))
+	}
+	for name, version := range pending.versions {
+		versions[name] = version
+	}
+	for _, name := range pending.removed {
+		delete(versions, name)
+	}
+	s.resourceVersions[typeURL] = versions
+
+	s.first = false
+	delete(s.pendingDiffs, typeURL)
+}
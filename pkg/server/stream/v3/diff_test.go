@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDiffAgainstAndCommit(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	foo := &discovery.DiscoveryResponse{VersionInfo: "v1"}
+	bar := &discovery.DiscoveryResponse{VersionInfo: "v2"}
+
+	added, removed, err := s.DiffAgainst("eds", map[string]proto.Message{"foo": foo, "bar": bar})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 2 || len(removed) != 0 {
+		t.Fatalf("first diff against empty state: added=%v removed=%v, want both resources added and none removed", added, removed)
+	}
+
+	// A failed send must not poison the known state: without CommitDiff, a
+	// second diff against the same input must still report both as added.
+	added, removed, err = s.DiffAgainst("eds", map[string]proto.Message{"foo": foo, "bar": bar})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 2 || len(removed) != 0 {
+		t.Fatalf("diff before commit must be idempotent: added=%v removed=%v", added, removed)
+	}
+
+	s.CommitDiff("eds")
+
+	// Re-diffing the identical set after a commit must report no changes.
+	added, removed, err = s.DiffAgainst("eds", map[string]proto.Message{"foo": foo, "bar": bar})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("diff against unchanged committed state: added=%v removed=%v, want none", added, removed)
+	}
+
+	// Dropping "bar" must surface it as removed right away, but drop it from
+	// the stored resourceVersions only after commit.
+	added, removed, err = s.DiffAgainst("eds", map[string]proto.Message{"foo": foo})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 0 || len(removed) != 1 || removed[0] != "bar" {
+		t.Fatalf("diff after dropping bar: added=%v removed=%v, want bar removed", added, removed)
+	}
+	if _, ok := s.GetResourceVersions("eds")["bar"]; !ok {
+		t.Fatalf("uncommitted diff must not remove bar from resourceVersions yet")
+	}
+
+	s.CommitDiff("eds")
+	if _, ok := s.GetResourceVersions("eds")["bar"]; ok {
+		t.Fatalf("committed diff must remove bar from resourceVersions")
+	}
+}
+
+func TestCommitDiffWithoutPendingDiffIsNoop(t *testing.T) {
+	s := NewStreamState(false, map[string]map[string]string{"eds": {"foo": "v1"}})
+	s.CommitDiff("eds")
+	if s.GetResourceVersions("eds")["foo"] != "v1" {
+		t.Fatalf("CommitDiff without a pending diff must leave resourceVersions untouched")
+	}
+}
+
+// TestDiffAgainstScopedPerTypeURL covers the case the fix in this commit
+// addresses: a CDS cluster and an EDS ClusterLoadAssignment sharing the name
+// "foo" on the same aggregated stream must not clobber each other's
+// committed version, and committing one type URL must not make the other's
+// unchanged resource look added or removed.
+func TestDiffAgainstScopedPerTypeURL(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	cdsFoo := &discovery.DiscoveryResponse{VersionInfo: "cds-v1"}
+	edsFoo := &discovery.DiscoveryResponse{VersionInfo: "eds-v1"}
+
+	added, _, err := s.DiffAgainst("cds", map[string]proto.Message{"foo": cdsFoo})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 1 {
+		t.Fatalf("first cds diff: added=%v, want foo added", added)
+	}
+	s.CommitDiff("cds")
+
+	added, _, err = s.DiffAgainst("eds", map[string]proto.Message{"foo": edsFoo})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 1 {
+		t.Fatalf("first eds diff: added=%v, want foo added", added)
+	}
+	s.CommitDiff("eds")
+
+	// Re-diffing the unchanged cds "foo" must report no changes: committing
+	// eds's "foo" must not have overwritten cds's version for that name.
+	added, removed, err := s.DiffAgainst("cds", map[string]proto.Message{"foo": cdsFoo})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("re-diffing unchanged cds foo after eds commit: added=%v removed=%v, want none", added, removed)
+	}
+}
+
+// TestInterleavedDiffAgainstDoesNotClobberPendingDiff covers the bug the
+// per-type-URL pendingDiffs map fixes: calling DiffAgainst for a second type
+// URL before the first type URL's diff is committed must not discard the
+// first type URL's pending diff.
+func TestInterleavedDiffAgainstDoesNotClobberPendingDiff(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	cdsFoo := &discovery.DiscoveryResponse{VersionInfo: "cds-v1"}
+	edsBar := &discovery.DiscoveryResponse{VersionInfo: "eds-v1"}
+
+	if _, _, err := s.DiffAgainst("cds", map[string]proto.Message{"foo": cdsFoo}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Diffing eds before committing cds must not discard the cds pending diff.
+	if _, _, err := s.DiffAgainst("eds", map[string]proto.Message{"bar": edsBar}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.CommitDiff("cds")
+	if _, ok := s.GetResourceVersions("cds")["foo"]; !ok {
+		t.Fatalf("committing cds after an interleaved eds diff must still commit cds's pending diff")
+	}
+
+	s.CommitDiff("eds")
+	if _, ok := s.GetResourceVersions("eds")["bar"]; !ok {
+		t.Fatalf("eds's pending diff must still be committable after cds was committed")
+	}
+}
@@ -0,0 +1,92 @@
+package stream
+
+// NOTE: this tree has no Stream/DeltaStream server loop (the
+// pkg/server/sotw, pkg/server/delta loops this was written for don't exist
+// here) to call the helpers in this file from. SetSentNonce,
+// SetSentNonceDelta, IsExpiredNonce, IsAck, ConsumeNonce, SetNackCallback and
+// OnNack are exercised directly by nonce_test.go, but their intended
+// integration into a real request-handling loop is unverified.
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// nonceState snapshots what was sent to the client under a given nonce, so
+// that a later ACK/NACK referencing it can be correlated back to the exact
+// state that produced it.
+type nonceState struct {
+	// versionInfo is the version_info sent alongside this nonce on a SOTW response.
+	versionInfo string
+
+	// resourceVersions is the resource name->version map sent alongside this
+	// nonce on a delta response.
+	resourceVersions map[string]string
+}
+
+// NonceCallback is invoked with the ErrorDetail of a NACK for a given type URL.
+type NonceCallback func(typeURL string, nonce string, errorDetail *status.Status)
+
+// SetSentNonce records the nonce sent to the client for a SOTW response of
+// the given type URL, along with the version_info it carries.
+func (s *StreamState) SetSentNonce(typeURL, nonce, versionInfo string) {
+	s.sentNonces[typeURL] = nonce
+	s.nonceStates[typeURL] = nonceState{versionInfo: versionInfo}
+}
+
+// SetSentNonceDelta records the nonce sent to the client for a delta response
+// of the given type URL, along with the resource versions it carries.
+func (s *StreamState) SetSentNonceDelta(typeURL, nonce string, resourceVersions map[string]string) {
+	s.sentNonces[typeURL] = nonce
+	s.nonceStates[typeURL] = nonceState{resourceVersions: resourceVersions}
+}
+
+// IsExpiredNonce returns true if nonce is not the most recent nonce sent for
+// typeURL. An empty nonce is never expired, since it corresponds to the very
+// first request on a stream, before anything has been sent.
+func (s *StreamState) IsExpiredNonce(typeURL, nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+	return s.sentNonces[typeURL] != nonce
+}
+
+// IsAck returns true if nonce is a fresh ACK for typeURL, i.e. it matches the
+// most recent nonce sent for that type URL and errorDetail is nil. A NACK
+// echoes the same nonce as an ACK would, distinguished only by carrying a
+// non-nil ErrorDetail, so errorDetail must always be the ErrorDetail of the
+// request nonce came from.
+func (s *StreamState) IsAck(typeURL, nonce string, errorDetail *status.Status) bool {
+	if nonce == "" || errorDetail != nil {
+		return false
+	}
+	return s.sentNonces[typeURL] == nonce
+}
+
+// ConsumeNonce validates nonce against the most recently sent nonce for
+// typeURL and, if it is a fresh ACK, returns the snapshot of what was sent
+// under it so the caller can commit resourceVersions/knownResourceNames.
+// errorDetail must be the ErrorDetail of the request nonce came from:
+// ConsumeNonce returns ok=false for a NACK (non-nil errorDetail) exactly as
+// it does for a stale nonce, since a NACK must never be committed. Callers
+// handling a NACK must call OnNack instead.
+func (s *StreamState) ConsumeNonce(typeURL, nonce string, errorDetail *status.Status) (versionInfo string, resourceVersions map[string]string, ok bool) {
+	if !s.IsAck(typeURL, nonce, errorDetail) {
+		return "", nil, false
+	}
+	state := s.nonceStates[typeURL]
+	return state.versionInfo, state.resourceVersions, true
+}
+
+// SetNackCallback registers a callback invoked whenever a NACK (a
+// DiscoveryRequest/DeltaDiscoveryRequest carrying a non-nil ErrorDetail) is
+// observed for typeURL. Passing nil disables the callback.
+func (s *StreamState) SetNackCallback(cb NonceCallback) {
+	s.nackCallback = cb
+}
+
+// OnNack reports errorDetail to the registered NACK callback, if any.
+func (s *StreamState) OnNack(typeURL, nonce string, errorDetail *status.Status) {
+	if s.nackCallback != nil && errorDetail != nil {
+		s.nackCallback(typeURL, nonce, errorDetail)
+	}
+}
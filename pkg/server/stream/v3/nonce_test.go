@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+)
+
+func TestNonceExpiry(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	if s.IsExpiredNonce("eds", "") {
+		t.Errorf("empty nonce must never be expired")
+	}
+	if s.IsAck("eds", "", nil) {
+		t.Errorf("empty nonce must never be an ack")
+	}
+
+	s.SetSentNonce("eds", "nonce-1", "v1")
+
+	if s.IsExpiredNonce("eds", "nonce-1") {
+		t.Errorf("most recently sent nonce must not be expired")
+	}
+	if !s.IsExpiredNonce("eds", "nonce-0") {
+		t.Errorf("stale nonce must be expired")
+	}
+	if !s.IsAck("eds", "nonce-1", nil) {
+		t.Errorf("most recently sent nonce must be an ack")
+	}
+	if s.IsAck("eds", "nonce-0", nil) {
+		t.Errorf("stale nonce must not be an ack")
+	}
+	if s.IsAck("eds", "nonce-1", &status.Status{Message: "boom"}) {
+		t.Errorf("a matching nonce with a non-nil ErrorDetail is a NACK, not an ack")
+	}
+
+	// A nonce sent for a different type URL must not interfere.
+	s.SetSentNonce("cds", "nonce-7", "v7")
+	if s.IsExpiredNonce("eds", "nonce-1") {
+		t.Errorf("nonce tracking must be scoped per type URL")
+	}
+}
+
+func TestConsumeNonce(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	s.SetSentNonce("cds", "nonce-1", "v1")
+	if _, _, ok := s.ConsumeNonce("cds", "nonce-0", nil); ok {
+		t.Errorf("stale nonce must not be consumable")
+	}
+	if _, _, ok := s.ConsumeNonce("cds", "nonce-1", &status.Status{Message: "boom"}); ok {
+		t.Errorf("a NACK must not be consumable")
+	}
+	versionInfo, resourceVersions, ok := s.ConsumeNonce("cds", "nonce-1", nil)
+	if !ok {
+		t.Fatalf("fresh ack must be consumable")
+	}
+	if versionInfo != "v1" {
+		t.Errorf("versionInfo = %q, want %q", versionInfo, "v1")
+	}
+	if resourceVersions != nil {
+		t.Errorf("resourceVersions = %v, want nil for a SOTW nonce", resourceVersions)
+	}
+
+	delta := map[string]string{"foo": "hash1"}
+	s.SetSentNonceDelta("eds", "nonce-2", delta)
+	_, resourceVersions, ok = s.ConsumeNonce("eds", "nonce-2", nil)
+	if !ok {
+		t.Fatalf("fresh delta ack must be consumable")
+	}
+	if resourceVersions["foo"] != "hash1" {
+		t.Errorf("resourceVersions = %v, want %v", resourceVersions, delta)
+	}
+}
+
+func TestNackCallback(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	var gotTypeURL, gotNonce string
+	s.SetNackCallback(func(typeURL, nonce string, errorDetail *status.Status) {
+		gotTypeURL, gotNonce = typeURL, nonce
+	})
+
+	s.OnNack("eds", "nonce-1", nil)
+	if gotTypeURL != "" {
+		t.Errorf("callback must not fire for a nil ErrorDetail")
+	}
+
+	s.OnNack("eds", "nonce-1", &status.Status{Message: "boom"})
+	if gotTypeURL != "eds" || gotNonce != "nonce-1" {
+		t.Errorf("callback did not fire with the expected typeURL/nonce, got %q/%q", gotTypeURL, gotNonce)
+	}
+}
@@ -0,0 +1,79 @@
+package stream
+
+import "time"
+
+// NOTE: this tree has no Stream/DeltaStream server loop for Observer to be
+// wired into (the pkg/server/sotw, pkg/server/delta loops this was written
+// for don't exist here). StreamState.observer is stored and exposed via
+// SetObserver/GetObserver, but nothing in this repository calls OnStreamOpen,
+// OnStreamClosed, OnStreamRequest, OnStreamResponse, OnExpiredNonce,
+// OnWriteTimeout or OnInternalError yet; that integration is unverified.
+
+// Observer receives notifications for key events on a Stream/DeltaStream
+// server loop, so that implementations can plug in metrics or tracing
+// (e.g. Prometheus or OpenTelemetry counters) without forking the server.
+// All methods must be safe for concurrent use, since a server may drive many
+// streams at once.
+type Observer interface {
+	// OnStreamOpen is called when a new stream is opened, for the node
+	// identified by nodeID (the Node.id of the first request on the stream;
+	// empty if the node has not identified itself yet).
+	OnStreamOpen(streamID int64, nodeID string)
+
+	// OnStreamClosed is called when a stream is closed.
+	OnStreamClosed(streamID int64, nodeID string)
+
+	// OnStreamRequest is called when a request is received on the stream for
+	// typeURL. ack and nack indicate whether the request acknowledges or
+	// rejects the previous response sent for that type URL.
+	OnStreamRequest(streamID int64, nodeID, typeURL string, ack, nack bool)
+
+	// OnStreamResponse is called after a response has been sent on the
+	// stream, with the number of resources and bytes it carried and how long
+	// it took from the watch firing to Send returning.
+	OnStreamResponse(streamID int64, nodeID, typeURL string, numResources, numBytes int, sendDuration time.Duration)
+
+	// OnExpiredNonce is called when a request arrives carrying a nonce that
+	// is no longer the most recently sent one for typeURL.
+	OnExpiredNonce(streamID int64, nodeID, typeURL string)
+
+	// OnWriteTimeout is called when a response could not be sent to the
+	// client within the configured timeout.
+	OnWriteTimeout(streamID int64, nodeID, typeURL string)
+
+	// OnInternalError is called when the server loop hits an internal error
+	// while serving typeURL.
+	OnInternalError(streamID int64, nodeID, typeURL string, err error)
+}
+
+// NoopObserver is an Observer that does nothing. It is the default used when
+// no Observer has been configured.
+type NoopObserver struct{}
+
+func (NoopObserver) OnStreamOpen(int64, string)                                      {}
+func (NoopObserver) OnStreamClosed(int64, string)                                    {}
+func (NoopObserver) OnStreamRequest(int64, string, string, bool, bool)               {}
+func (NoopObserver) OnStreamResponse(int64, string, string, int, int, time.Duration) {}
+func (NoopObserver) OnExpiredNonce(int64, string, string)                            {}
+func (NoopObserver) OnWriteTimeout(int64, string, string)                            {}
+func (NoopObserver) OnInternalError(int64, string, string, error)                    {}
+
+var _ Observer = NoopObserver{}
+
+// SetObserver registers the Observer to notify of stream events. Passing nil
+// reverts to NoopObserver.
+func (s *StreamState) SetObserver(observer Observer) {
+	if observer == nil {
+		observer = NoopObserver{}
+	}
+	s.observer = observer
+}
+
+// GetObserver returns the currently registered Observer, or NoopObserver if
+// none has been set.
+func (s *StreamState) GetObserver() Observer {
+	if s.observer == nil {
+		return NoopObserver{}
+	}
+	return s.observer
+}
@@ -0,0 +1,104 @@
+// Package prometheus provides a ready-made stream.Observer that records xDS
+// server events as Prometheus metrics.
+package prometheus
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	stream "review/go-control-plane/pkg/server/stream/v3"
+)
+
+// Observer is a stream.Observer that records xDS server events as
+// Prometheus metrics, keyed by type URL and node ID. It is equivalent to the
+// pilot_total_xds_internal_errors, pilot_xds_expired_nonce and
+// pilot_xds_write_timeout counters used by Istio.
+type Observer struct {
+	StreamsOpen    prometheus.Gauge
+	Requests       *prometheus.CounterVec
+	Responses      *prometheus.CounterVec
+	ExpiredNonces  *prometheus.CounterVec
+	WriteTimeouts  *prometheus.CounterVec
+	InternalErrors *prometheus.CounterVec
+	SendDuration   *prometheus.HistogramVec
+}
+
+// NewObserver creates an Observer and registers its collectors with reg.
+func NewObserver(reg prometheus.Registerer) *Observer {
+	o := &Observer{
+		StreamsOpen: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pilot_total_xds_streams_open",
+			Help: "Number of currently open xDS streams.",
+		}),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pilot_total_xds_requests",
+			Help: "Number of xDS requests received, by node ID, type URL and ack/nack.",
+		}, []string{"node_id", "type_url", "ack", "nack"}),
+		Responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pilot_total_xds_responses",
+			Help: "Number of xDS responses sent, by node ID and type URL.",
+		}, []string{"node_id", "type_url"}),
+		ExpiredNonces: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pilot_xds_expired_nonce",
+			Help: "Number of xDS requests received with an expired nonce, by node ID and type URL.",
+		}, []string{"node_id", "type_url"}),
+		WriteTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pilot_xds_write_timeout",
+			Help: "Number of xDS response writes that timed out, by node ID and type URL.",
+		}, []string{"node_id", "type_url"}),
+		InternalErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pilot_total_xds_internal_errors",
+			Help: "Number of internal errors encountered serving xDS, by node ID and type URL.",
+		}, []string{"node_id", "type_url"}),
+		SendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pilot_xds_send_duration_seconds",
+			Help:    "Time from a watch firing to the xDS response Send call returning, by node ID and type URL.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"node_id", "type_url"}),
+	}
+
+	reg.MustRegister(
+		o.StreamsOpen,
+		o.Requests,
+		o.Responses,
+		o.ExpiredNonces,
+		o.WriteTimeouts,
+		o.InternalErrors,
+		o.SendDuration,
+	)
+
+	return o
+}
+
+func (o *Observer) OnStreamOpen(streamID int64, nodeID string) {
+	o.StreamsOpen.Inc()
+}
+
+func (o *Observer) OnStreamClosed(streamID int64, nodeID string) {
+	o.StreamsOpen.Dec()
+}
+
+func (o *Observer) OnStreamRequest(streamID int64, nodeID, typeURL string, ack, nack bool) {
+	o.Requests.WithLabelValues(nodeID, typeURL, strconv.FormatBool(ack), strconv.FormatBool(nack)).Inc()
+}
+
+func (o *Observer) OnStreamResponse(streamID int64, nodeID, typeURL string, numResources, numBytes int, sendDuration time.Duration) {
+	o.Responses.WithLabelValues(nodeID, typeURL).Inc()
+	o.SendDuration.WithLabelValues(nodeID, typeURL).Observe(sendDuration.Seconds())
+}
+
+func (o *Observer) OnExpiredNonce(streamID int64, nodeID, typeURL string) {
+	o.ExpiredNonces.WithLabelValues(nodeID, typeURL).Inc()
+}
+
+func (o *Observer) OnWriteTimeout(streamID int64, nodeID, typeURL string) {
+	o.WriteTimeouts.WithLabelValues(nodeID, typeURL).Inc()
+}
+
+func (o *Observer) OnInternalError(streamID int64, nodeID, typeURL string, err error) {
+	o.InternalErrors.WithLabelValues(nodeID, typeURL).Inc()
+}
+
+var _ stream.Observer = (*Observer)(nil)
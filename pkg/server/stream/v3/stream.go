@@ -41,51 +41,95 @@ func (s *SotwSubscribed) setNames(names []string) {
 
 // StreamState will keep track of resource state per type on a stream.
 type StreamState struct { // nolint:golint,revive
-	// Indicates whether the delta stream currently has a wildcard watch
-	wildcard bool
-
-	// Provides the list of resources explicitly requested by the client
-	// This list might be non-empty even when set as wildcard
-	subscribedResourceNames map[string]struct{}
+	// initialWildcard is the wildcard default passed to NewStreamState. It
+	// applies to any type URL that ApplySubscriptionDelta/SetWildcard has
+	// not yet explicitly set, so a non-aggregated delta-xDS stream (one type
+	// URL, the case this struct was originally built for) can be
+	// constructed already in wildcard mode without an explicit subscribe.
+	initialWildcard bool
+
+	// wildcard holds, per type URL, whether the delta stream currently has
+	// a wildcard watch for that type URL. Keyed like subscribedResourceNames
+	// since a name or wildcard watch on one type URL of an aggregated
+	// stream is independent of every other type URL on it.
+	wildcard map[string]bool
+
+	// subscribedResourceNames holds, per type URL, the resources explicitly
+	// requested by the client. A type URL's set might be non-empty even
+	// when that type URL is also wildcard.
+	subscribedResourceNames map[string]map[string]struct{}
 
 	// type url to state
 	subscriedSotwResources map[string]*SotwSubscribed
 
-	// ResourceVersions contains a hash of the resource as the value and the resource name as the key.
-	// This field stores the last state sent to the client.
-	resourceVersions map[string]string
+	// resourceVersions holds, per type URL, a hash of each resource as the
+	// value and the resource name as the key. This field stores the last
+	// state sent to the client for that type URL. It is keyed by type URL,
+	// like sentNonces/nonceStates/knownResourceNames, since it is shared
+	// across every type URL on an aggregated stream and a flat map would
+	// let two type URLs with a colliding resource name (e.g. a CDS cluster
+	// and an EDS ClusterLoadAssignment sharing a name) clobber each other's
+	// versions.
+	resourceVersions map[string]map[string]string
 
 	// knownResourceNames contains resource names that a client has received previously
 	knownResourceNames map[string]map[string]struct{}
 
+	// sentNonces holds, per type URL, the most recent nonce sent to the client.
+	sentNonces map[string]string
+
+	// nonceStates holds, per type URL, a snapshot of what was sent under sentNonces.
+	nonceStates map[string]nonceState
+
+	// nackCallback is invoked with the ErrorDetail of a NACK, if one is set.
+	nackCallback NonceCallback
+
+	// pendingDiffs holds, per type URL, the result of the most recent
+	// DiffAgainst call for that type URL, until it is applied by
+	// CommitDiff. Keyed like resourceVersions so that an uncommitted diff
+	// for one type URL survives a DiffAgainst call for another.
+	pendingDiffs map[string]*pendingDiff
+
+	// observer is notified of stream events. Defaults to NoopObserver.
+	observer Observer
+
+	// unsubscribedResourceNames contains, per type URL, the resource names
+	// the client has explicitly unsubscribed from via
+	// ApplySubscriptionDelta, so the server can distinguish "never knew
+	// about it" from "explicitly unsubscribed".
+	unsubscribedResourceNames map[string]map[string]struct{}
+
 	// indicates whether the object has been modified since its creation
 	first bool
 }
 
-// GetSubscribedResourceNames returns the list of resources currently explicitly subscribed to
+// GetSubscribedResourceNames returns the list of resources currently explicitly subscribed to for typeURL.
 // If the request is set to wildcard it may be empty
 // Currently populated only when using delta-xds
-func (s *StreamState) GetSubscribedResourceNames() map[string]struct{} {
-	return s.subscribedResourceNames
+func (s *StreamState) GetSubscribedResourceNames(typeURL string) map[string]struct{} {
+	return s.subscribedResourceNames[typeURL]
 }
 
-// SetSubscribedResourceNames is setting the list of resources currently explicitly subscribed to
-// It is decorrelated from the wildcard state of the stream
+// SetSubscribedResourceNames is setting the list of resources currently explicitly subscribed to for typeURL.
+// It is decorrelated from the wildcard state of that type URL
 // Currently used only when using delta-xds
-func (s *StreamState) SetSubscribedResourceNames(subscribedResourceNames map[string]struct{}) {
-	s.subscribedResourceNames = subscribedResourceNames
+func (s *StreamState) SetSubscribedResourceNames(typeURL string, subscribedResourceNames map[string]struct{}) {
+	if s.subscribedResourceNames == nil {
+		s.subscribedResourceNames = map[string]map[string]struct{}{}
+	}
+	s.subscribedResourceNames[typeURL] = subscribedResourceNames
 }
 
-// WatchesResources returns whether at least one of the resource provided is currently watch by the stream
-// It is currently only applicable to delta-xds
-// If the request is wildcard, it will always return true
-// Otherwise it will compare the provided resources to the list of resources currently subscribed
-func (s *StreamState) WatchesResources(resourceNames map[string]struct{}) bool {
-	if s.IsWildcard() {
+// WatchesResources returns whether at least one of the resource provided is currently watched by the
+// stream for typeURL. It is currently only applicable to delta-xds.
+// If typeURL is wildcard, it will always return true
+// Otherwise it will compare the provided resources to the list of resources currently subscribed for typeURL
+func (s *StreamState) WatchesResources(typeURL string, resourceNames map[string]struct{}) bool {
+	if s.IsWildcard(typeURL) {
 		return true
 	}
 	for resourceName := range resourceNames {
-		if _, ok := s.subscribedResourceNames[resourceName]; ok {
+		if _, ok := s.subscribedResourceNames[typeURL][resourceName]; ok {
 			return true
 		}
 	}
@@ -95,15 +139,19 @@ func (s *StreamState) WatchesResources(resourceNames map[string]struct{}) bool {
 // SetSubscribedSotwResources is setting the list of resources currently explicitly subscribed to
 func (s *StreamState) SetSubscribedSotwResources(url string, names []string) {
 	if _, found := s.subscriedSotwResources[url]; found {
+		// Once a type URL has been explicitly set on this stream, an empty
+		// resource_names list is itself significant: it means the client is
+		// explicitly unsubscribing from everything, not "no change". Always
+		// replace with the (possibly empty) new set.
 		newResources := &SotwSubscribed{
 			subscribedResourceNames: make(map[string]struct{}),
 		}
 		newResources.setNames(names)
 		s.subscriedSotwResources[url] = newResources
 	} else {
-		// At first, when names are unset, it's *.
-		// Here wew use not found to present not setting, which means *.
-		// Notice, LDS, CDS are always empty, and we need to keep this if all requests are unset until it's set.
+		// At first, when names are unset, whether the type URL is wildcard
+		// depends on its default. Here we use not found to represent not
+		// having been set yet, which means the default for url.
 		// https://www.envoyproxy.io/docs/envoy/v1.24.0/api-docs/xds_protocol#how-the-client-specifies-what-resources-to-return
 		if len(names) == 0 {
 			return
@@ -121,7 +169,7 @@ func (s *StreamState) WatchesSotwAll(url string) bool {
 	resources, found := s.subscriedSotwResources[url]
 	// We don't set it when it's always unset. See SetSubscribedSotwResources
 	if !found {
-		return true
+		return IsWildcardTypeURL(url)
 	}
 	if resources.wildcard {
 		return true
@@ -133,8 +181,9 @@ func (s *StreamState) WatchesSotwAll(url string) bool {
 func (s *StreamState) WatchesSotwAllNew(url string, names []string) bool {
 	if _, found := s.subscriedSotwResources[url]; !found {
 		// Here wew use not found to present not setting, which means *.
+		// With no names, * applies only where IsWildcardTypeURL(url) holds.
 		if len(names) == 0 {
-			return true
+			return IsWildcardTypeURL(url)
 		}
 	}
 	newResources := &SotwSubscribed{
@@ -149,7 +198,7 @@ func (s *StreamState) WatchesSotwResource(url string, name string) bool {
 	resources, found := s.subscriedSotwResources[url]
 	if !found {
 		// We don't set it when it's always unset. See SetSubscribedSotwResources
-		return true
+		return IsWildcardTypeURL(url)
 	}
 	if resources.wildcard {
 		return true
@@ -160,25 +209,40 @@ func (s *StreamState) WatchesSotwResource(url string, name string) bool {
 	return false
 }
 
-func (s *StreamState) GetResourceVersions() map[string]string {
-	return s.resourceVersions
+// GetResourceVersions returns the resource versions last committed for typeURL.
+func (s *StreamState) GetResourceVersions(typeURL string) map[string]string {
+	return s.resourceVersions[typeURL]
 }
 
-func (s *StreamState) SetResourceVersions(resourceVersions map[string]string) {
+// SetResourceVersions sets the resource versions for typeURL.
+func (s *StreamState) SetResourceVersions(typeURL string, resourceVersions map[string]string) {
 	s.first = false
-	s.resourceVersions = resourceVersions
+	if s.resourceVersions == nil {
+		s.resourceVersions = make(map[string]map[string]string)
+	}
+	s.resourceVersions[typeURL] = resourceVersions
 }
 
 func (s *StreamState) IsFirst() bool {
 	return s.first
 }
 
-func (s *StreamState) SetWildcard(wildcard bool) {
-	s.wildcard = wildcard
+// SetWildcard sets whether typeURL currently has a wildcard watch.
+func (s *StreamState) SetWildcard(typeURL string, wildcard bool) {
+	if s.wildcard == nil {
+		s.wildcard = map[string]bool{}
+	}
+	s.wildcard[typeURL] = wildcard
 }
 
-func (s *StreamState) IsWildcard() bool {
-	return s.wildcard
+// IsWildcard returns whether typeURL currently has a wildcard watch. If
+// typeURL has not been explicitly set yet, it returns the wildcard default
+// the stream was constructed with.
+func (s *StreamState) IsWildcard(typeURL string) bool {
+	if wildcard, ok := s.wildcard[typeURL]; ok {
+		return wildcard
+	}
+	return s.initialWildcard
 }
 
 func (s *StreamState) SetKnownResourceNames(url string, names map[string]struct{}) {
@@ -197,19 +261,27 @@ func (s *StreamState) GetKnownResourceNames(url string) map[string]struct{} {
 	return s.knownResourceNames[url]
 }
 
-// NewStreamState initializes a stream state.
-func NewStreamState(wildcard bool, initialResourceVersions map[string]string) StreamState {
+// NewStreamState initializes a stream state. wildcard is the wildcard
+// default for any type URL not yet explicitly set via
+// ApplySubscriptionDelta/SetWildcard. initialResourceVersions, if given, is
+// keyed by type URL.
+func NewStreamState(wildcard bool, initialResourceVersions map[string]map[string]string) StreamState {
 	state := StreamState{
-		wildcard:                wildcard,
-		subscribedResourceNames: map[string]struct{}{},
-		subscriedSotwResources:  map[string]*SotwSubscribed{},
-		resourceVersions:        initialResourceVersions,
-		first:                   true,
-		knownResourceNames:      map[string]map[string]struct{}{},
+		initialWildcard:           wildcard,
+		wildcard:                  map[string]bool{},
+		subscribedResourceNames:   map[string]map[string]struct{}{},
+		subscriedSotwResources:    map[string]*SotwSubscribed{},
+		resourceVersions:          initialResourceVersions,
+		first:                     true,
+		knownResourceNames:        map[string]map[string]struct{}{},
+		sentNonces:                map[string]string{},
+		nonceStates:               map[string]nonceState{},
+		observer:                  NoopObserver{},
+		unsubscribedResourceNames: map[string]map[string]struct{}{},
 	}
 
 	if initialResourceVersions == nil {
-		state.resourceVersions = make(map[string]string)
+		state.resourceVersions = make(map[string]map[string]string)
 	}
 
 	return state
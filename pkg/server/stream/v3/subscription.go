@@ -0,0 +1,74 @@
+package stream
+
+// ApplySubscriptionDelta mutates the stream's subscription state according to
+// an incremental resource_names_subscribe/resource_names_unsubscribe pair
+// from a DeltaDiscoveryRequest, and returns the effective delta after
+// deduplication against what the stream already knows: names already
+// subscribed to are not reported as newly subscribed, and names that were
+// never known are not reported as newly unsubscribed.
+//
+// Subscribing to "*" transitions typeURL into wildcard mode; unsubscribing
+// from "*" transitions it back out, per the xDS delta protocol.
+//
+// Like unsubscribedResourceNames, the subscribed-names and wildcard state
+// this mutates (StreamState.subscribedResourceNames,
+// StreamState.wildcard) are keyed per typeURL, so on an aggregated stream
+// serving more than one type URL, a name subscribed under one type is never
+// confused with the same name subscribed under another, and wildcard mode
+// on one type URL never leaks to another.
+func (s *StreamState) ApplySubscriptionDelta(typeURL string, subscribe, unsubscribe []string) (newlySubscribed, newlyUnsubscribed map[string]struct{}, err error) {
+	newlySubscribed = make(map[string]struct{})
+	newlyUnsubscribed = make(map[string]struct{})
+
+	unsubscribed, ok := s.unsubscribedResourceNames[typeURL]
+	if !ok {
+		unsubscribed = make(map[string]struct{})
+		s.unsubscribedResourceNames[typeURL] = unsubscribed
+	}
+
+	subscribedResourceNames, ok := s.subscribedResourceNames[typeURL]
+	if !ok {
+		subscribedResourceNames = make(map[string]struct{})
+		s.subscribedResourceNames[typeURL] = subscribedResourceNames
+	}
+
+	for _, name := range subscribe {
+		if name == "*" {
+			s.SetWildcard(typeURL, true)
+			// Re-entering wildcard mode means the client wants the full set
+			// again, so any previous explicit unsubscriptions no longer
+			// apply for this type URL.
+			unsubscribed = make(map[string]struct{})
+			s.unsubscribedResourceNames[typeURL] = unsubscribed
+			continue
+		}
+		if _, known := subscribedResourceNames[name]; !known {
+			newlySubscribed[name] = struct{}{}
+		}
+		subscribedResourceNames[name] = struct{}{}
+		delete(unsubscribed, name)
+	}
+
+	for _, name := range unsubscribe {
+		if name == "*" {
+			s.SetWildcard(typeURL, false)
+			continue
+		}
+		if _, known := subscribedResourceNames[name]; known {
+			newlyUnsubscribed[name] = struct{}{}
+		}
+		delete(subscribedResourceNames, name)
+		unsubscribed[name] = struct{}{}
+	}
+
+	return newlySubscribed, newlyUnsubscribed, nil
+}
+
+// IsExplicitlyUnsubscribed returns whether the client has explicitly
+// unsubscribed from name on typeURL and has not re-subscribed since. The
+// server must not send a removed_resources entry for name again while this
+// holds, since the client already knows it is gone.
+func (s *StreamState) IsExplicitlyUnsubscribed(typeURL, name string) bool {
+	_, ok := s.unsubscribedResourceNames[typeURL][name]
+	return ok
+}
@@ -0,0 +1,106 @@
+package stream
+
+import "testing"
+
+func TestApplySubscriptionDeltaBasic(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	newlySubscribed, newlyUnsubscribed, err := s.ApplySubscriptionDelta("eds", []string{"foo", "bar"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(newlySubscribed) != 2 || len(newlyUnsubscribed) != 0 {
+		t.Fatalf("newlySubscribed=%v newlyUnsubscribed=%v, want foo and bar newly subscribed", newlySubscribed, newlyUnsubscribed)
+	}
+
+	// Re-subscribing to an already known resource must not report it again.
+	newlySubscribed, _, err = s.ApplySubscriptionDelta("eds", []string{"foo"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(newlySubscribed) != 0 {
+		t.Errorf("newlySubscribed = %v, want none for an already-known resource", newlySubscribed)
+	}
+
+	_, newlyUnsubscribed, err = s.ApplySubscriptionDelta("eds", nil, []string{"foo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(newlyUnsubscribed) != 1 || !s.IsExplicitlyUnsubscribed("eds", "foo") {
+		t.Fatalf("expected foo to be reported and tracked as explicitly unsubscribed")
+	}
+
+	// Unsubscribing again from an already-unknown resource must not report it.
+	_, newlyUnsubscribed, err = s.ApplySubscriptionDelta("eds", nil, []string{"foo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(newlyUnsubscribed) != 0 {
+		t.Errorf("newlyUnsubscribed = %v, want none for an already-unsubscribed resource", newlyUnsubscribed)
+	}
+}
+
+func TestApplySubscriptionDeltaWildcardTransitions(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	if _, _, err := s.ApplySubscriptionDelta("eds", []string{"*"}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s.IsWildcard("eds") {
+		t.Fatalf("expected subscribing to * to enter wildcard mode")
+	}
+
+	if _, _, err := s.ApplySubscriptionDelta("eds", nil, []string{"*"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.IsWildcard("eds") {
+		t.Fatalf("expected unsubscribing from * to leave wildcard mode")
+	}
+}
+
+func TestApplySubscriptionDeltaResubscribeToWildcardClearsUnsubscribed(t *testing.T) {
+	s := NewStreamState(true, nil)
+
+	if _, _, err := s.ApplySubscriptionDelta("eds", nil, []string{"foo"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s.IsExplicitlyUnsubscribed("eds", "foo") {
+		t.Fatalf("expected foo to be tracked as explicitly unsubscribed")
+	}
+
+	if _, _, err := s.ApplySubscriptionDelta("eds", []string{"*"}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.IsExplicitlyUnsubscribed("eds", "foo") {
+		t.Errorf("re-subscribing to * must clear prior explicit unsubscriptions for eds, so foo can be resent")
+	}
+}
+
+// TestApplySubscriptionDeltaScopedPerTypeURL covers the case the per-type
+// wildcard/subscribedResourceNames fix addresses: on an aggregated stream,
+// subscribing to "*" for one type URL must not make another type URL
+// wildcard, and a name subscribed under one type URL must not be visible to
+// another type URL that shares it.
+func TestApplySubscriptionDeltaScopedPerTypeURL(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	if _, _, err := s.ApplySubscriptionDelta("cds", []string{"*"}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s.IsWildcard("cds") {
+		t.Fatalf("expected cds to be wildcard after subscribing to *")
+	}
+	if s.IsWildcard("eds") {
+		t.Fatalf("cds entering wildcard mode must not leak to eds")
+	}
+
+	if _, _, err := s.ApplySubscriptionDelta("rds", []string{"foo"}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.WatchesResources("eds", map[string]struct{}{"foo": {}}) {
+		t.Errorf("eds is not wildcard and never subscribed to foo, so it must not watch it just because rds did")
+	}
+	if !s.WatchesResources("rds", map[string]struct{}{"foo": {}}) {
+		t.Errorf("expected rds to watch foo after subscribing to it")
+	}
+}
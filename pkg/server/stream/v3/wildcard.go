@@ -0,0 +1,54 @@
+package stream
+
+// Well-known v3 type URLs that default to wildcard semantics when a client's
+// initial request carries no resource_names, per the xDS protocol:
+// https://www.envoyproxy.io/docs/envoy/latest/api-docs/xds_protocol#how-the-client-specifies-what-resources-to-return
+const (
+	ListenerTypeURL    = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	ClusterTypeURL     = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	ScopedRouteTypeURL = "type.googleapis.com/envoy.config.route.v3.ScopedRouteConfiguration"
+	RuntimeTypeURL     = "type.googleapis.com/envoy.service.runtime.v3.Runtime"
+
+	// AggregateTypeURL is the empty type URL used on ADS streams, where a
+	// single request can carry resources of any type; it is always wildcard.
+	AggregateTypeURL = ""
+)
+
+// TypeURLPolicy records, per type URL, whether an empty initial resource_names
+// list should be interpreted as a wildcard subscription. LDS, CDS, SRDS, RTDS
+// and the ADS/aggregate type default to wildcard; EDS, RDS, SDS and other
+// resource-scoped types do not and must be explicitly subscribed to.
+type TypeURLPolicy struct {
+	defaultWildcard map[string]struct{}
+}
+
+// DefaultTypeURLPolicy returns the policy matching the well-known v3 type
+// URLs' default wildcard behavior.
+func DefaultTypeURLPolicy() *TypeURLPolicy {
+	return &TypeURLPolicy{
+		defaultWildcard: map[string]struct{}{
+			ListenerTypeURL:    {},
+			ClusterTypeURL:     {},
+			ScopedRouteTypeURL: {},
+			RuntimeTypeURL:     {},
+			AggregateTypeURL:   {},
+		},
+	}
+}
+
+// IsWildcardByDefault returns whether typeURL defaults to wildcard semantics
+// when a client's initial request carries no resource_names.
+func (p *TypeURLPolicy) IsWildcardByDefault(typeURL string) bool {
+	_, ok := p.defaultWildcard[typeURL]
+	return ok
+}
+
+var defaultTypeURLPolicy = DefaultTypeURLPolicy()
+
+// IsWildcardTypeURL returns whether typeURL defaults to wildcard semantics
+// when a client's initial request carries no resource_names, using the
+// well-known v3 type URLs (Listener, Cluster, ScopedRoute, Runtime and the
+// ADS/aggregate case).
+func IsWildcardTypeURL(typeURL string) bool {
+	return defaultTypeURLPolicy.IsWildcardByDefault(typeURL)
+}
@@ -0,0 +1,80 @@
+package stream
+
+import "testing"
+
+func TestIsWildcardTypeURL(t *testing.T) {
+	cases := []struct {
+		typeURL string
+		want    bool
+	}{
+		{ListenerTypeURL, true},
+		{ClusterTypeURL, true},
+		{ScopedRouteTypeURL, true},
+		{RuntimeTypeURL, true},
+		{AggregateTypeURL, true},
+		{"type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment", false},
+		{"type.googleapis.com/envoy.config.route.v3.RouteConfiguration", false},
+	}
+	for _, c := range cases {
+		if got := IsWildcardTypeURL(c.typeURL); got != c.want {
+			t.Errorf("IsWildcardTypeURL(%q) = %v, want %v", c.typeURL, got, c.want)
+		}
+	}
+}
+
+func TestWatchesSotwDefaultsByTypeURL(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	// Never set: LDS/CDS-like types default to wildcard, EDS-like types don't.
+	if !s.WatchesSotwAll(ListenerTypeURL) {
+		t.Errorf("unset LDS must default to wildcard")
+	}
+	if s.WatchesSotwAll("eds") {
+		t.Errorf("unset EDS must not default to wildcard")
+	}
+	if !s.WatchesSotwResource(ListenerTypeURL, "anything") {
+		t.Errorf("unset LDS must watch any resource by default")
+	}
+	if s.WatchesSotwResource("eds", "anything") {
+		t.Errorf("unset EDS must not watch any resource by default")
+	}
+}
+
+func TestSetSubscribedSotwResourcesExplicitUnsubscribeToEmpty(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	s.SetSubscribedSotwResources("eds", []string{"foo", "bar"})
+	if !s.WatchesSotwResource("eds", "foo") {
+		t.Fatalf("expected eds to watch foo after explicit subscribe")
+	}
+
+	// Client sends an empty resource_names list: it has unsubscribed from
+	// everything, it did not revert to "no change".
+	s.SetSubscribedSotwResources("eds", []string{})
+	if s.WatchesSotwResource("eds", "foo") {
+		t.Errorf("WatchesSotwResource(eds, foo) = true after unsubscribing from everything, want false")
+	}
+	if s.WatchesSotwAll("eds") {
+		t.Errorf("WatchesSotwAll(eds) = true after unsubscribing from everything, want false")
+	}
+}
+
+func TestSetSubscribedSotwResourcesWildcardTransitions(t *testing.T) {
+	s := NewStreamState(false, nil)
+
+	// Explicit -> wildcard.
+	s.SetSubscribedSotwResources("eds", []string{"foo"})
+	s.SetSubscribedSotwResources("eds", []string{"*"})
+	if !s.WatchesSotwAll("eds") {
+		t.Errorf("expected eds to be wildcard after subscribing to *")
+	}
+
+	// Wildcard -> explicit.
+	s.SetSubscribedSotwResources("eds", []string{"bar"})
+	if s.WatchesSotwAll("eds") {
+		t.Errorf("expected eds to no longer be wildcard after subscribing to an explicit list")
+	}
+	if !s.WatchesSotwResource("eds", "bar") || s.WatchesSotwResource("eds", "foo") {
+		t.Errorf("expected eds to watch only bar after the explicit transition")
+	}
+}